@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/urfave/cli/v2"
+
+	"github.com/Xiangze-Li/delete-old-files/pkg/delold"
+)
+
+var restoreCommand = &cli.Command{
+	Name:  "restore",
+	Usage: "restore files previously moved to the trash by --trash",
+
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "yes",
+			Aliases: []string{"y"},
+			Usage:   "restore all trashed files without prompting",
+		},
+	},
+
+	Action: func(ctx *cli.Context) error {
+		dir, err := delold.XDGTrashDir()
+		if err != nil {
+			return err
+		}
+		items, err := delold.ListTrash(dir)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			fmt.Println("Trash is empty")
+			return nil
+		}
+
+		selected := items
+		if !ctx.Bool("yes") {
+			options := make([]string, len(items))
+			for i, it := range items {
+				options[i] = fmt.Sprintf("%s (from %s)", it.Name, it.OriginalPath)
+			}
+			var chosen []string
+			survey.AskOne(&survey.MultiSelect{
+				Message: "Select files to restore",
+				Options: options,
+				Default: options,
+			}, &chosen)
+
+			byOption := make(map[string]delold.TrashedItem, len(items))
+			for i, it := range items {
+				byOption[options[i]] = it
+			}
+			selected = make([]delold.TrashedItem, 0, len(chosen))
+			for _, c := range chosen {
+				selected = append(selected, byOption[c])
+			}
+		}
+
+		hasErr := false
+		for _, it := range selected {
+			if it.OriginalPath == "" {
+				log.Println(fmt.Errorf("%s: trashinfo file has no recorded Path, skipping", it.Name))
+				hasErr = true
+				continue
+			}
+			if err := delold.MoveFile(path.Join(dir, "files", it.Name), it.OriginalPath); err != nil {
+				log.Println(err)
+				hasErr = true
+				continue
+			}
+			os.Remove(path.Join(dir, "info", it.Name+".trashinfo"))
+		}
+
+		if hasErr {
+			return fmt.Errorf("Failed to restore some files")
+		}
+		fmt.Println("Finished restoring selected files")
+		return nil
+	},
+}
+
+var emptyTrashCommand = &cli.Command{
+	Name:  "empty-trash",
+	Usage: "permanently delete all files currently in the trash",
+
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "yes",
+			Aliases: []string{"y"},
+			Usage:   "empty the trash without prompting",
+		},
+	},
+
+	Action: func(ctx *cli.Context) error {
+		dir, err := delold.XDGTrashDir()
+		if err != nil {
+			return err
+		}
+		items, err := delold.ListTrash(dir)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			fmt.Println("Trash is already empty")
+			return nil
+		}
+
+		if !ctx.Bool("yes") {
+			ans := false
+			survey.AskOne(&survey.Confirm{
+				Message: fmt.Sprintf("Permanently delete all %d file(s) in the trash?", len(items)),
+				Default: false,
+			}, &ans)
+			if !ans {
+				fmt.Println("Aborted")
+				return nil
+			}
+		}
+
+		hasErr := false
+		for _, it := range items {
+			if err := os.Remove(path.Join(dir, "files", it.Name)); err != nil && !os.IsNotExist(err) {
+				log.Println(err)
+				hasErr = true
+			}
+			if err := os.Remove(path.Join(dir, "info", it.Name+".trashinfo")); err != nil && !os.IsNotExist(err) {
+				log.Println(err)
+				hasErr = true
+			}
+		}
+
+		if hasErr {
+			return fmt.Errorf("Failed to empty some files from the trash")
+		}
+		fmt.Println("Trash emptied")
+		return nil
+	},
+}
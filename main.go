@@ -2,17 +2,21 @@ package main
 
 import (
 	"fmt"
-	"io/fs"
 	"log"
 	"os"
+	"os/exec"
 	"path"
+	"path/filepath"
 	"regexp"
-	"sort"
+	"runtime"
+	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/dustin/go-humanize"
 	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli/v2"
+
+	"github.com/Xiangze-Li/delete-old-files/pkg/delold"
 )
 
 var app = &cli.App{
@@ -21,10 +25,9 @@ var app = &cli.App{
 
 	Flags: []cli.Flag{
 		&cli.StringFlag{
-			Name:     "pattern",
-			Aliases:  []string{"e", "p"},
-			Usage:    "regular expression used to match files",
-			Required: true,
+			Name:    "pattern",
+			Aliases: []string{"e", "p"},
+			Usage:   "regular expression used to match files",
 		},
 		&cli.IntFlag{
 			Name:    "number",
@@ -50,59 +53,188 @@ var app = &cli.App{
 			Usage:   "delete files without confirmation",
 			Value:   false,
 		},
+		&cli.BoolFlag{
+			Name:    "recursive",
+			Aliases: []string{"r"},
+			Usage:   "recurse into subdirectories",
+			Value:   false,
+		},
+		&cli.IntFlag{
+			Name:  "max-depth",
+			Usage: "maximum recursion depth below the working directory; negative means unlimited, ignored unless --recursive is set",
+			Value: -1,
+		},
+		&cli.StringSliceFlag{
+			Name:  "include",
+			Usage: "regular expression a relative path must match to be considered; repeatable, any match is enough",
+		},
+		&cli.StringSliceFlag{
+			Name:  "exclude",
+			Usage: "regular expression a relative path must not match; repeatable, matches on a directory skip its whole subtree",
+		},
+		&cli.BoolFlag{
+			Name:  "follow-symlinks",
+			Usage: "follow symlinks to directories while recursing",
+			Value: false,
+		},
+		&cli.StringFlag{
+			Name:  "older-than",
+			Usage: "only consider files last modified more than this long ago, e.g. 7d, 1h, 30m",
+		},
+		&cli.StringFlag{
+			Name:  "newer-than",
+			Usage: "only consider files last modified within this long, e.g. 1h, 15m",
+		},
+		&cli.StringFlag{
+			Name:  "min-size",
+			Usage: "only consider files at least this large, e.g. 10MiB",
+		},
+		&cli.StringFlag{
+			Name:  "max-size",
+			Usage: "only consider files at most this large, e.g. 1GiB",
+		},
+		&cli.StringFlag{
+			Name:  "group-by",
+			Usage: "regular expression with a capture group partitioning matched files into retention groups, e.g. backup-(\\d{4}-\\d{2}-\\d{2})-.*\\.tar",
+		},
+		&cli.IntFlag{
+			Name:  "keep-last",
+			Usage: "within each retention group, keep the N most recently modified files",
+		},
+		&cli.IntFlag{
+			Name:  "keep-daily",
+			Usage: "within each retention group, keep the most recent file for each of the last N distinct days",
+		},
+		&cli.IntFlag{
+			Name:  "keep-weekly",
+			Usage: "within each retention group, keep the most recent file for each of the last N distinct weeks",
+		},
+		&cli.IntFlag{
+			Name:  "keep-monthly",
+			Usage: "within each retention group, keep the most recent file for each of the last N distinct months",
+		},
+		&cli.BoolFlag{
+			Name:  "trash",
+			Usage: "move files to the XDG trash instead of deleting them; see the restore and empty-trash subcommands",
+		},
+		&cli.StringFlag{
+			Name:  "backup-dir",
+			Usage: "move files under this directory instead of deleting them, preserving their relative path",
+		},
+		&cli.BoolFlag{
+			Name:  "secure",
+			Usage: "overwrite file contents with zeros before unlinking; cannot be combined with --trash or --backup-dir",
+		},
+		&cli.BoolFlag{
+			Name:  "dedup",
+			Usage: "group matched files by content and delete all but one representative per group, instead of --number/retention selection",
+		},
+		&cli.StringFlag{
+			Name:  "hash-algo",
+			Usage: "hash algorithm used by --dedup: sha256 or blake3",
+			Value: string(delold.HashAlgoSHA256),
+		},
+		&cli.StringFlag{
+			Name:  "dedup-keep",
+			Usage: "which file to keep within a --dedup group: newest or oldest",
+			Value: "newest",
+		},
+		&cli.StringFlag{
+			Name:  "hash-cache",
+			Usage: "path to a bbolt database caching --dedup file hashes across runs; disabled if unset",
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "render the preview and report as json, ndjson, or csv; when unset, a table is shown if stdout is a terminal and json is written otherwise",
+		},
+		&cli.StringFlag{
+			Name:  "log-file",
+			Usage: "append one NDJSON line per deletion event to this file as it happens",
+		},
+		&cli.IntFlag{
+			Name:  "concurrency",
+			Usage: "number of files deleted in parallel",
+			Value: runtime.NumCPU(),
+		},
+		&cli.StringFlag{
+			Name:  "rate-limit",
+			Usage: "throttle deletions to at most this many files or bytes per second, e.g. 20/s or 5MiB/s",
+		},
+	},
+
+	Commands: []*cli.Command{
+		restoreCommand,
+		emptyTrashCommand,
 	},
 
 	Action: func(ctx *cli.Context) error {
-		pattern := ctx.String("pattern")
-		re, err := regexp.Compile(pattern)
+		// --pattern can't be Required at the flag level: urfave/cli checks
+		// required root flags before dispatching to a subcommand, which
+		// would make restoreCommand/emptyTrashCommand unusable. Validate it
+		// here instead, where only the root Action's own path runs.
+		if ctx.String("pattern") == "" {
+			return fmt.Errorf(`required flag "pattern" not set`)
+		}
+
+		policy, cache, err := policyFromFlags(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to compile pattern: %w", err)
+			return err
+		}
+		if cache != nil {
+			defer cache.Close()
 		}
 
-		fileNameSelf := path.Base(os.Args[0])
 		prefix := ctx.String("path")
-		arrFileInfo, err := listByTime(prefix)
+		scanOpt := delold.ScanOptions{
+			Dir:            prefix,
+			Recursive:      ctx.Bool("recursive"),
+			MaxDepth:       ctx.Int("max-depth"),
+			FollowSymlinks: ctx.Bool("follow-symlinks"),
+		}
+		scanOpt.Include, err = delold.CompilePatterns(ctx.StringSlice("include"))
+		if err != nil {
+			return fmt.Errorf("failed to compile include pattern: %w", err)
+		}
+		scanOpt.Exclude, err = delold.CompilePatterns(ctx.StringSlice("exclude"))
+		if err != nil {
+			return fmt.Errorf("failed to compile exclude pattern: %w", err)
+		}
+
+		entries, err := delold.Scan(scanOpt)
 		if err != nil {
 			return fmt.Errorf("%w", err)
 		}
 
-		arrMatch := make([]os.FileInfo, 0, len(arrFileInfo))
-		for _, fi := range arrFileInfo {
-			if fi.Name() == fileNameSelf {
-				continue
-			}
-			if re.MatchString(fi.Name()) {
-				arrMatch = append(arrMatch, fi)
-			}
+		plan, err := delold.BuildPlan(prefix, entries, policy)
+		if err != nil {
+			return err
 		}
 
-		if len(arrMatch) == 0 {
+		if len(plan.Delete) == 0 {
 			fmt.Println("No matching files found")
 			return nil
 		}
 
-		number := ctx.Int("number")
-		if number > 0 {
-			if len(arrMatch) > number {
-				arrMatch = arrMatch[:number]
-			}
-		} else if number < 0 {
-			if len(arrMatch) > -number {
-				arrMatch = arrMatch[:len(arrMatch)+number]
-			} else {
-				fmt.Println("All matching files will be kept due to given number flag")
-				return nil
-			}
+		interactive := ctx.String("output") == "" && isTerminal(os.Stdout)
+		format := delold.OutputFormat(ctx.String("output"))
+		if format == "" {
+			format = delold.FormatJSON
 		}
 
-		printResult(arrMatch)
+		if interactive {
+			printResult(plan.Delete)
+		} else if err := delold.WriteEntries(os.Stdout, plan.Delete, format); err != nil {
+			return fmt.Errorf("failed to render preview: %w", err)
+		}
 
 		if ctx.Bool("dry-run") {
 			return nil
 		}
 
-		confirm := false
-		if !ctx.Bool("yes") {
+		toDelete := plan.Delete
+		confirm := ctx.Bool("yes")
+		if !confirm && interactive {
 			ans := "No"
 			survey.AskOne(&survey.Select{
 				Message: "All files above will be deleted, continue?",
@@ -112,32 +244,27 @@ var app = &cli.App{
 			switch ans {
 			case "Yes":
 				confirm = true
-			case "No":
-				confirm = false
 			case "Pick":
-				{
-					mapSel := make(map[string]fs.FileInfo, len(arrMatch))
-					arrSel := make([]string, 0, len(arrMatch))
-					for _, fi := range arrMatch {
-						mapSel[fi.Name()] = fi
-						arrSel = append(arrSel, fi.Name())
-					}
-					arrAns := make([]string, 0, len(arrMatch))
-					survey.AskOne(&survey.MultiSelect{
-						Message: "Select files to delete",
-						Options: arrSel,
-						Default: arrSel,
-					}, &arrAns)
-					arrMatch = make([]os.FileInfo, 0, len(arrAns))
-					for _, ans := range arrAns {
-						arrMatch = append(arrMatch, mapSel[ans])
-					}
-
-					confirm = len(arrMatch) > 0
+				mapSel := make(map[string]delold.Entry, len(toDelete))
+				arrSel := make([]string, 0, len(toDelete))
+				for _, e := range toDelete {
+					mapSel[e.Path] = e
+					arrSel = append(arrSel, e.Path)
+				}
+				var arrAns []string
+				survey.AskOne(&survey.MultiSelect{
+					Message: "Select files to delete",
+					Options: arrSel,
+					Default: arrSel,
+				}, &arrAns)
+				toDelete = make([]delold.Entry, 0, len(arrAns))
+				for _, ans := range arrAns {
+					toDelete = append(toDelete, mapSel[ans])
 				}
+				confirm = len(toDelete) > 0
 			}
-		} else {
-			confirm = true
+		} else if !confirm {
+			return fmt.Errorf("refusing to delete without --yes when not attached to a terminal or when --output is set")
 		}
 
 		if !confirm {
@@ -145,16 +272,55 @@ var app = &cli.App{
 			return nil
 		}
 
-		hasErr := false
-		for _, fi := range arrMatch {
-			err = os.Remove(path.Join(prefix, fi.Name()))
+		d, action, err := deleterFromFlags(ctx)
+		if err != nil {
+			return err
+		}
+
+		var logFile *os.File
+		if p := ctx.String("log-file"); p != "" {
+			logFile, err = os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
 			if err != nil {
-				log.Println(err)
-				hasErr = true
+				return fmt.Errorf("failed to open log file: %w", err)
+			}
+			defer logFile.Close()
+		}
+
+		applyOpt := delold.ApplyOptions{Concurrency: ctx.Int("concurrency")}
+		if s := ctx.String("rate-limit"); s != "" {
+			rate, byBytes, err := delold.ParseRateLimit(s)
+			if err != nil {
+				return err
+			}
+			applyOpt.RateLimiter = delold.NewRateLimiter(rate, byBytes)
+		}
+
+		var progress *progressReporter
+		if isTerminal(os.Stderr) {
+			progress = newProgressReporter(len(toDelete))
+		}
+
+		report := delold.Apply(delold.Plan{Delete: toDelete}, d, prefix, action, applyOpt, func(res delold.Result) {
+			if logFile != nil {
+				if err := delold.WriteEvent(logFile, res); err != nil {
+					log.Println(err)
+				}
+			}
+			if res.Error != "" {
+				log.Println(res.Error)
+			}
+			if progress != nil {
+				progress.record(res)
+			}
+		})
+
+		if !interactive {
+			if err := delold.WriteReport(os.Stdout, report, format); err != nil {
+				return fmt.Errorf("failed to render report: %w", err)
 			}
 		}
 
-		if hasErr {
+		if report.Errors > 0 {
 			return fmt.Errorf("Failed to delete some files")
 		}
 		fmt.Println("Finished deleting above files")
@@ -164,37 +330,175 @@ var app = &cli.App{
 	HideHelpCommand: true,
 }
 
-func listByTime(dir string) ([]os.FileInfo, error) {
-	fdDir, err := os.Open(dir)
+// selfSkipPath returns the path of the running binary relative to prefix, in
+// the same form Scan reports Entry.Path, so that policy.SkipPaths still
+// recognizes the binary when --recursive puts it in a subdirectory instead
+// of prefix itself. It falls back to the bare basename of os.Args[0] if the
+// binary's location can't be resolved or isn't under prefix, matching the
+// old behavior.
+func selfSkipPath(prefix string) string {
+	exe := os.Args[0]
+	if !strings.ContainsRune(exe, os.PathSeparator) {
+		if resolved, err := exec.LookPath(exe); err == nil {
+			exe = resolved
+		}
+	}
+
+	absExe, err := filepath.Abs(exe)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open directory: %w", err)
+		return path.Base(os.Args[0])
 	}
-	defer fdDir.Close()
-	if i, _ := fdDir.Stat(); !i.IsDir() {
-		return nil, fmt.Errorf("given path is not a directory")
+	absPrefix, err := filepath.Abs(prefix)
+	if err != nil {
+		return path.Base(os.Args[0])
 	}
 
-	arrFiles, err := fdDir.ReadDir(-1)
+	rel, err := filepath.Rel(absPrefix, absExe)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return path.Base(os.Args[0])
+	}
+	return rel
+}
+
+// policyFromFlags builds the delold.Policy describing which scanned
+// entries match and how to select deletion candidates among them. When
+// --dedup is set it also returns the hash cache it opened, if any, which
+// the caller is responsible for closing.
+func policyFromFlags(ctx *cli.Context) (delold.Policy, *delold.HashCache, error) {
+	re, err := regexp.Compile(ctx.String("pattern"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read entries in directory: %w", err)
+		return delold.Policy{}, nil, fmt.Errorf("failed to compile pattern: %w", err)
 	}
 
-	arrFileInfo := make([]os.FileInfo, 0, len(arrFiles))
+	policy := delold.Policy{
+		Pattern:   re,
+		SkipPaths: []string{selfSkipPath(ctx.String("path"))},
+		Number:    ctx.Int("number"),
+	}
 
-	for _, f := range arrFiles {
-		if f.IsDir() {
-			continue
+	if s := ctx.String("older-than"); s != "" {
+		d, err := delold.ParseDuration(s)
+		if err != nil {
+			return delold.Policy{}, nil, fmt.Errorf("failed to parse --older-than: %w", err)
+		}
+		policy.OlderThan = &d
+	}
+	if s := ctx.String("newer-than"); s != "" {
+		d, err := delold.ParseDuration(s)
+		if err != nil {
+			return delold.Policy{}, nil, fmt.Errorf("failed to parse --newer-than: %w", err)
 		}
-		if fi, err := f.Info(); err == nil {
-			arrFileInfo = append(arrFileInfo, fi)
+		policy.NewerThan = &d
+	}
+	if s := ctx.String("min-size"); s != "" {
+		n, err := humanize.ParseBytes(s)
+		if err != nil {
+			return delold.Policy{}, nil, fmt.Errorf("failed to parse --min-size: %w", err)
 		}
+		policy.MinSize = &n
+	}
+	if s := ctx.String("max-size"); s != "" {
+		n, err := humanize.ParseBytes(s)
+		if err != nil {
+			return delold.Policy{}, nil, fmt.Errorf("failed to parse --max-size: %w", err)
+		}
+		policy.MaxSize = &n
 	}
 
-	sort.Sort(sortByModtime(arrFileInfo))
-	return arrFileInfo, nil
+	policy.Retention = delold.RetentionPolicy{
+		KeepLast:    ctx.Int("keep-last"),
+		KeepDaily:   ctx.Int("keep-daily"),
+		KeepWeekly:  ctx.Int("keep-weekly"),
+		KeepMonthly: ctx.Int("keep-monthly"),
+	}
+	if s := ctx.String("group-by"); s != "" {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return delold.Policy{}, nil, fmt.Errorf("failed to compile --group-by pattern: %w", err)
+		}
+		if re.NumSubexp() < 1 {
+			return delold.Policy{}, nil, fmt.Errorf("--group-by pattern must have a capture group")
+		}
+		policy.Retention.GroupBy = re
+	}
+
+	var cache *delold.HashCache
+	if ctx.Bool("dedup") {
+		dedup, err := dedupOptionsFromFlags(ctx)
+		if err != nil {
+			return delold.Policy{}, nil, err
+		}
+		policy.Dedup = &dedup
+		cache = dedup.Cache
+	}
+
+	return policy, cache, nil
 }
 
-func printResult(r []os.FileInfo) {
+// dedupOptionsFromFlags builds delold.DedupOptions from the
+// --hash-algo/--dedup-keep/--hash-cache flags.
+func dedupOptionsFromFlags(ctx *cli.Context) (delold.DedupOptions, error) {
+	algo := delold.HashAlgo(ctx.String("hash-algo"))
+
+	var keepNewest bool
+	switch ctx.String("dedup-keep") {
+	case "newest", "":
+		keepNewest = true
+	case "oldest":
+		keepNewest = false
+	default:
+		return delold.DedupOptions{}, fmt.Errorf("invalid --dedup-keep %q, expected newest or oldest", ctx.String("dedup-keep"))
+	}
+
+	var cache *delold.HashCache
+	if cacheFile := ctx.String("hash-cache"); cacheFile != "" {
+		c, err := delold.OpenHashCache(cacheFile)
+		if err != nil {
+			return delold.DedupOptions{}, err
+		}
+		cache = c
+	}
+
+	return delold.DedupOptions{Algo: algo, KeepNewest: keepNewest, Cache: cache}, nil
+}
+
+// deleterFromFlags validates the --trash/--backup-dir/--secure flags and
+// builds the deleter they select, along with a short label for reports.
+func deleterFromFlags(ctx *cli.Context) (delold.Deleter, string, error) {
+	trash := ctx.Bool("trash")
+	backupDir := ctx.String("backup-dir")
+	secure := ctx.Bool("secure")
+
+	switch {
+	case trash && backupDir != "":
+		return nil, "", fmt.Errorf("--trash and --backup-dir are mutually exclusive")
+	case trash:
+		if secure {
+			return nil, "", fmt.Errorf("--secure has no effect together with --trash")
+		}
+		d, err := delold.NewTrashDeleter()
+		return d, "trash", err
+	case backupDir != "":
+		if secure {
+			return nil, "", fmt.Errorf("--secure has no effect together with --backup-dir")
+		}
+		return delold.BackupDeleter{Dir: backupDir}, "backup", nil
+	case secure:
+		return delold.RemoveDeleter{Secure: true}, "secure-delete", nil
+	default:
+		return delold.RemoveDeleter{}, "delete", nil
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+func printResult(r []delold.Entry) {
 	const truncateLen = 30
 
 	table := tablewriter.NewWriter(os.Stdout)
@@ -211,16 +515,16 @@ func printResult(r []os.FileInfo) {
 
 	var totalSize uint64
 
-	for i, fi := range r {
-		size := uint64(fi.Size())
+	for i, e := range r {
+		size := uint64(e.Info.Size())
 		totalSize += size
 		if i >= truncateLen {
 			continue
 		}
 		table.Append([]string{
-			fi.Name(),
+			e.Path,
 			humanize.IBytes(size),
-			fi.ModTime().Format("2006-01-02 15:04:05")})
+			e.Info.ModTime().Format("2006-01-02 15:04:05")})
 	}
 	table.SetAlignment(tablewriter.ALIGN_RIGHT)
 
@@ -238,15 +542,3 @@ func main() {
 		log.Fatal(err)
 	}
 }
-
-type sortByModtime []os.FileInfo
-
-func (s sortByModtime) Len() int {
-	return len(s)
-}
-func (s sortByModtime) Swap(i, j int) {
-	s[i], s[j] = s[j], s[i]
-}
-func (s sortByModtime) Less(i, j int) bool {
-	return s[i].ModTime().Before(s[j].ModTime())
-}
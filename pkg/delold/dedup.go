@@ -0,0 +1,279 @@
+package delold
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/zeebo/blake3"
+	bolt "go.etcd.io/bbolt"
+)
+
+const headSampleSize = 4 * 1024
+
+// HashAlgo selects the digest used by DedupEntries to compare file
+// contents.
+type HashAlgo string
+
+const (
+	HashAlgoSHA256 HashAlgo = "sha256"
+	HashAlgoBLAKE3 HashAlgo = "blake3"
+)
+
+func newHasher(algo HashAlgo) (hash.Hash, error) {
+	switch algo {
+	case HashAlgoSHA256, "":
+		return sha256.New(), nil
+	case HashAlgoBLAKE3:
+		return blake3.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q, expected sha256 or blake3", algo)
+	}
+}
+
+// HashCache memoizes digests across runs in a small bbolt database keyed by
+// (path, size, mtime), so a repeat run over an unchanged tree doesn't
+// rehash every file again.
+type HashCache struct {
+	db *bolt.DB
+}
+
+var hashCacheBucket = []byte("hashes")
+
+// OpenHashCache opens (creating if necessary) a hash cache at file.
+func OpenHashCache(file string) (*HashCache, error) {
+	db, err := bolt.Open(file, 0o600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hash cache: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(hashCacheBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize hash cache: %w", err)
+	}
+	return &HashCache{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (c *HashCache) Close() error {
+	return c.db.Close()
+}
+
+func cacheKey(algo HashAlgo, e Entry) []byte {
+	return []byte(fmt.Sprintf("%s\x00%s\x00%d\x00%d", algo, e.Path, e.Info.Size(), e.Info.ModTime().UnixNano()))
+}
+
+func (c *HashCache) get(algo HashAlgo, e Entry) (string, bool) {
+	var digest string
+	c.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(hashCacheBucket).Get(cacheKey(algo, e)); v != nil {
+			digest = string(v)
+		}
+		return nil
+	})
+	return digest, digest != ""
+}
+
+func (c *HashCache) put(algo HashAlgo, e Entry, digest string) {
+	c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(hashCacheBucket).Put(cacheKey(algo, e), []byte(digest))
+	})
+}
+
+func hashFile(prefix string, e Entry, algo HashAlgo) (string, error) {
+	f, err := os.Open(path.Join(prefix, e.Path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h, err := newHasher(algo)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// headSampleOf reads up to the first 4KiB of the file at e so files that
+// already differ there can be ruled out as duplicates without hashing the
+// rest of their contents.
+func headSampleOf(prefix string, e Entry) (string, error) {
+	f, err := os.Open(path.Join(prefix, e.Path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, headSampleSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
+
+func groupByKey(entries []Entry, keyOf func(Entry) (string, error)) (map[string][]Entry, error) {
+	groups := make(map[string][]Entry, len(entries))
+	for _, e := range entries {
+		k, err := keyOf(e)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Path, err)
+		}
+		groups[k] = append(groups[k], e)
+	}
+	return groups, nil
+}
+
+// DedupOptions configures DedupEntries.
+type DedupOptions struct {
+	Algo       HashAlgo
+	KeepNewest bool
+	Cache      *HashCache // optional
+}
+
+// DedupEntries groups entries by content and returns every entry except
+// one representative per group, i.e. the duplicates to delete.
+//
+// Entries are first bucketed by size, since files of unique size cannot
+// have a duplicate, then by a 4KiB head sample to rule out large files
+// that clearly differ, and only what remains is fully hashed.
+func DedupEntries(prefix string, entries []Entry, opt DedupOptions) ([]Entry, error) {
+	bySize := make(map[int64][]Entry, len(entries))
+	for _, e := range entries {
+		bySize[e.Info.Size()] = append(bySize[e.Info.Size()], e)
+	}
+
+	candidates := make([]Entry, 0, len(entries))
+	for _, group := range bySize {
+		if len(group) > 1 {
+			candidates = append(candidates, group...)
+		}
+	}
+
+	byHeadSample, err := groupByKey(candidates, func(e Entry) (string, error) { return headSampleOf(prefix, e) })
+	if err != nil {
+		return nil, err
+	}
+
+	toHash := make([]Entry, 0, len(candidates))
+	for _, group := range byHeadSample {
+		if len(group) > 1 {
+			toHash = append(toHash, group...)
+		}
+	}
+
+	digests, err := hashAll(prefix, toHash, opt.Algo, opt.Cache)
+	if err != nil {
+		return nil, err
+	}
+
+	byDigest := make(map[string][]Entry, len(toHash))
+	for _, e := range toHash {
+		byDigest[digests[e.Path]] = append(byDigest[digests[e.Path]], e)
+	}
+
+	toDelete := make([]Entry, 0, len(toHash))
+	for _, group := range byDigest {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Sort(sortByModtime(group))
+		keepIdx := 0
+		if opt.KeepNewest {
+			keepIdx = len(group) - 1
+		}
+		for i, e := range group {
+			if i != keepIdx {
+				toDelete = append(toDelete, e)
+			}
+		}
+	}
+	return toDelete, nil
+}
+
+// hashAll hashes entries with a bounded worker pool, consulting cache
+// first when one is configured, and returns a map from entry path to
+// digest.
+func hashAll(prefix string, entries []Entry, algo HashAlgo, cache *HashCache) (map[string]string, error) {
+	type result struct {
+		path   string
+		digest string
+		err    error
+	}
+
+	workers := runtime.NumCPU()
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(entries) {
+		workers = len(entries)
+	}
+
+	digests := make(map[string]string, len(entries))
+	if workers == 0 {
+		return digests, nil
+	}
+
+	jobs := make(chan Entry)
+	results := make(chan result)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range jobs {
+				if cache != nil {
+					if digest, ok := cache.get(algo, e); ok {
+						results <- result{path: e.Path, digest: digest}
+						continue
+					}
+				}
+				digest, err := hashFile(prefix, e, algo)
+				if err == nil && cache != nil {
+					cache.put(algo, e, digest)
+				}
+				results <- result{path: e.Path, digest: digest, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for _, e := range entries {
+			jobs <- e
+		}
+		close(jobs)
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var firstErr error
+	for r := range results {
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", r.path, r.err)
+			}
+			continue
+		}
+		digests[r.path] = r.digest
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return digests, nil
+}
@@ -0,0 +1,124 @@
+package delold
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFileEntry writes content to name under dir with the given mtime and
+// returns the Entry Scan would have produced for it.
+func writeFileEntry(t *testing.T, dir, name, content string, modTime time.Time) Entry {
+	t.Helper()
+	full := filepath.Join(dir, name)
+	if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile(%s): %v", name, err)
+	}
+	if err := os.Chtimes(full, modTime, modTime); err != nil {
+		t.Fatalf("Chtimes(%s): %v", name, err)
+	}
+	fi, err := os.Stat(full)
+	if err != nil {
+		t.Fatalf("Stat(%s): %v", name, err)
+	}
+	return Entry{Path: name, Info: fi}
+}
+
+func TestDedupEntries_NoDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		writeFileEntry(t, dir, "a", "hello", base),
+		writeFileEntry(t, dir, "b", "world", base),
+	}
+
+	toDelete, err := DedupEntries(dir, entries, DedupOptions{})
+	if err != nil {
+		t.Fatalf("DedupEntries: %v", err)
+	}
+	if len(toDelete) != 0 {
+		t.Fatalf("DedupEntries(no duplicates) = %v, want empty", toDelete)
+	}
+}
+
+func TestDedupEntries_SameSizeDifferentContent(t *testing.T) {
+	// Same size rules the size prefilter out, but the content still
+	// differs, so neither the head-sample nor the full hash should call
+	// these duplicates.
+	dir := t.TempDir()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		writeFileEntry(t, dir, "a", "aaaaa", base),
+		writeFileEntry(t, dir, "b", "bbbbb", base),
+	}
+
+	toDelete, err := DedupEntries(dir, entries, DedupOptions{})
+	if err != nil {
+		t.Fatalf("DedupEntries: %v", err)
+	}
+	if len(toDelete) != 0 {
+		t.Fatalf("DedupEntries(same size, different content) = %v, want empty", toDelete)
+	}
+}
+
+func TestDedupEntries_KeepOldestByDefault(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		writeFileEntry(t, dir, "old", "duplicate", base),
+		writeFileEntry(t, dir, "new", "duplicate", base.Add(time.Hour)),
+	}
+
+	toDelete, err := DedupEntries(dir, entries, DedupOptions{})
+	if err != nil {
+		t.Fatalf("DedupEntries: %v", err)
+	}
+	if len(toDelete) != 1 || toDelete[0].Path != "new" {
+		t.Fatalf("DedupEntries(KeepNewest:false) = %v, want [new]", toDelete)
+	}
+}
+
+func TestDedupEntries_KeepNewest(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		writeFileEntry(t, dir, "old", "duplicate", base),
+		writeFileEntry(t, dir, "new", "duplicate", base.Add(time.Hour)),
+	}
+
+	toDelete, err := DedupEntries(dir, entries, DedupOptions{KeepNewest: true})
+	if err != nil {
+		t.Fatalf("DedupEntries: %v", err)
+	}
+	if len(toDelete) != 1 || toDelete[0].Path != "old" {
+		t.Fatalf("DedupEntries(KeepNewest:true) = %v, want [old]", toDelete)
+	}
+}
+
+func TestDedupEntries_Empty(t *testing.T) {
+	toDelete, err := DedupEntries(t.TempDir(), nil, DedupOptions{})
+	if err != nil {
+		t.Fatalf("DedupEntries(nil): %v", err)
+	}
+	if len(toDelete) != 0 {
+		t.Fatalf("DedupEntries(nil) = %v, want empty", toDelete)
+	}
+}
+
+func TestDedupEntries_BLAKE3(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		writeFileEntry(t, dir, "old", "duplicate", base),
+		writeFileEntry(t, dir, "new", "duplicate", base.Add(time.Hour)),
+	}
+
+	toDelete, err := DedupEntries(dir, entries, DedupOptions{Algo: HashAlgoBLAKE3})
+	if err != nil {
+		t.Fatalf("DedupEntries: %v", err)
+	}
+	if len(toDelete) != 1 || toDelete[0].Path != "new" {
+		t.Fatalf("DedupEntries(blake3) = %v, want [new]", toDelete)
+	}
+}
@@ -0,0 +1,18 @@
+// Package delold implements the scan/plan/apply pipeline behind the
+// delete-old-files command line tool: find files matching a pattern,
+// decide which of them to get rid of under a selection policy, and remove
+// them through a pluggable Deleter. It has no dependency on a terminal and
+// can be embedded in other programs or driven by scripts.
+package delold
+
+import "os"
+
+// Entry is a file found by Scan, carrying the path it was found at relative
+// to the directory that was scanned. Keeping that relative path alongside
+// os.FileInfo (which only knows the file's base name) lets recursive scans
+// and deletions agree on which file is meant even when several
+// subdirectories share a name.
+type Entry struct {
+	Path string
+	Info os.FileInfo
+}
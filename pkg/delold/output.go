@@ -0,0 +1,119 @@
+package delold
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// OutputFormat selects how WriteEntries and WriteReport render their
+// machine-readable output.
+type OutputFormat string
+
+const (
+	FormatJSON   OutputFormat = "json"
+	FormatNDJSON OutputFormat = "ndjson"
+	FormatCSV    OutputFormat = "csv"
+)
+
+// entryRecord is the flattened, encoding-friendly shape of an Entry.
+type entryRecord struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime string `json:"mod_time"`
+}
+
+func recordOf(e Entry) entryRecord {
+	return entryRecord{Path: e.Path, Size: e.Info.Size(), ModTime: e.Info.ModTime().Format(time.RFC3339)}
+}
+
+// WriteEntries renders entries as JSON, NDJSON, or CSV.
+func WriteEntries(w io.Writer, entries []Entry, format OutputFormat) error {
+	records := make([]entryRecord, len(entries))
+	for i, e := range entries {
+		records[i] = recordOf(e)
+	}
+
+	switch format {
+	case FormatJSON:
+		return json.NewEncoder(w).Encode(records)
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"path", "size", "mod_time"}); err != nil {
+			return err
+		}
+		for _, r := range records {
+			if err := cw.Write([]string{r.Path, strconv.FormatInt(r.Size, 10), r.ModTime}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// resultRecord is the flattened, encoding-friendly shape of a Result.
+type resultRecord struct {
+	entryRecord
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+func resultRecordOf(r Result) resultRecord {
+	return resultRecord{entryRecord: recordOf(r.Entry), Action: r.Action, Error: r.Error}
+}
+
+// WriteReport renders a Report as JSON, NDJSON, or CSV.
+func WriteReport(w io.Writer, report Report, format OutputFormat) error {
+	records := make([]resultRecord, len(report.Results))
+	for i, r := range report.Results {
+		records[i] = resultRecordOf(r)
+	}
+
+	switch format {
+	case FormatJSON:
+		return json.NewEncoder(w).Encode(records)
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"path", "size", "mod_time", "action", "error"}); err != nil {
+			return err
+		}
+		for _, r := range records {
+			if err := cw.Write([]string{r.Path, strconv.FormatInt(r.Size, 10), r.ModTime, r.Action, r.Error}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// WriteEvent appends a single Result to w as one NDJSON line, for
+// --log-file to record deletions as they happen rather than only once
+// Apply returns.
+func WriteEvent(w io.Writer, r Result) error {
+	return json.NewEncoder(w).Encode(resultRecordOf(r))
+}
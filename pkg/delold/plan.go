@@ -0,0 +1,209 @@
+package delold
+
+import (
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Policy describes how BuildPlan turns a set of scanned entries into a
+// Plan: which of them match at all, which to exclude regardless of match,
+// and how to pick deletion candidates among what's left.
+type Policy struct {
+	Pattern   *regexp.Regexp // entries must match this against Path
+	SkipPaths []string       // entries matching exactly one of these are never selected
+
+	OlderThan *time.Duration
+	NewerThan *time.Duration
+	MinSize   *uint64
+	MaxSize   *uint64
+
+	// Number of files to delete if positive, or to keep if negative; ALL
+	// matching files are selected if zero. Ignored when Retention is
+	// Active or Dedup is set.
+	Number int
+
+	Retention RetentionPolicy
+	Dedup     *DedupOptions
+}
+
+// Plan is the outcome of BuildPlan: the entries an Apply call would delete,
+// and the ones it would leave alone.
+type Plan struct {
+	Keep   []Entry
+	Delete []Entry
+}
+
+// BuildPlan matches entries against policy, then selects deletion
+// candidates among the matches using, in order of precedence, Dedup,
+// Retention, or the plain Number count.
+func BuildPlan(prefix string, entries []Entry, policy Policy) (Plan, error) {
+	matched := matchEntries(entries, policy)
+
+	var (
+		toDelete []Entry
+		err      error
+	)
+	switch {
+	case policy.Dedup != nil:
+		toDelete, err = DedupEntries(prefix, matched, *policy.Dedup)
+	case policy.Retention.Active():
+		toDelete = ApplyRetention(matched, policy.Retention)
+	default:
+		toDelete = selectByNumber(matched, policy.Number)
+	}
+	if err != nil {
+		return Plan{}, err
+	}
+
+	return Plan{Keep: keepEntries(matched, toDelete), Delete: toDelete}, nil
+}
+
+func matchEntries(entries []Entry, policy Policy) []Entry {
+	skip := make(map[string]bool, len(policy.SkipPaths))
+	for _, p := range policy.SkipPaths {
+		skip[p] = true
+	}
+
+	matched := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		if skip[e.Path] {
+			continue
+		}
+		if policy.Pattern != nil && !policy.Pattern.MatchString(e.Path) {
+			continue
+		}
+		if policy.OlderThan != nil && !AgePredicate(*policy.OlderThan, false)(e) {
+			continue
+		}
+		if policy.NewerThan != nil && !AgePredicate(*policy.NewerThan, true)(e) {
+			continue
+		}
+		if policy.MinSize != nil && uint64(e.Info.Size()) < *policy.MinSize {
+			continue
+		}
+		if policy.MaxSize != nil && uint64(e.Info.Size()) > *policy.MaxSize {
+			continue
+		}
+		matched = append(matched, e)
+	}
+	return matched
+}
+
+func selectByNumber(entries []Entry, number int) []Entry {
+	switch {
+	case number > 0:
+		if len(entries) > number {
+			return entries[:number]
+		}
+		return entries
+	case number < 0:
+		if len(entries) > -number {
+			return entries[:len(entries)+number]
+		}
+		return nil
+	default:
+		return entries
+	}
+}
+
+func keepEntries(all, toDelete []Entry) []Entry {
+	deleted := make(map[string]bool, len(toDelete))
+	for _, e := range toDelete {
+		deleted[e.Path] = true
+	}
+	keep := make([]Entry, 0, len(all)-len(toDelete))
+	for _, e := range all {
+		if !deleted[e.Path] {
+			keep = append(keep, e)
+		}
+	}
+	return keep
+}
+
+// Result records the outcome of applying a Deleter to a single Entry.
+type Result struct {
+	Entry  Entry
+	Action string
+	Error  string // empty on success
+}
+
+// Report aggregates the Results of an Apply call.
+type Report struct {
+	Results []Result
+	Errors  int
+}
+
+// ApplyOptions controls how Apply spreads deletions across workers.
+type ApplyOptions struct {
+	// Concurrency is the number of files deleted at once. Values below 1
+	// are treated as 1.
+	Concurrency int
+	// RateLimiter, if set, is consulted before each deletion to throttle
+	// how fast Apply works through plan.Delete.
+	RateLimiter *RateLimiter
+}
+
+// Apply runs d over every entry in plan.Delete using opt.Concurrency
+// workers, tagging each Result with action (e.g. "delete", "trash",
+// "backup") and reporting it through onResult as soon as it's known, in
+// addition to the aggregate Report returned once every entry has been
+// processed. onResult may be nil; it is called from the goroutine that
+// called Apply, one Result at a time, as workers finish.
+func Apply(plan Plan, d Deleter, prefix, action string, opt ApplyOptions, onResult func(Result)) Report {
+	workers := opt.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(plan.Delete) {
+		workers = len(plan.Delete)
+	}
+
+	report := Report{Results: make([]Result, 0, len(plan.Delete))}
+	if workers == 0 {
+		return report
+	}
+
+	jobs := make(chan Entry)
+	results := make(chan Result)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range jobs {
+				if opt.RateLimiter != nil {
+					opt.RateLimiter.Wait(e)
+				}
+				res := Result{Entry: e, Action: action}
+				if err := d.Delete(prefix, e); err != nil {
+					res.Error = err.Error()
+				}
+				results <- res
+			}
+		}()
+	}
+
+	go func() {
+		for _, e := range plan.Delete {
+			jobs <- e
+		}
+		close(jobs)
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for res := range results {
+		if res.Error != "" {
+			report.Errors++
+		}
+		report.Results = append(report.Results, res)
+		if onResult != nil {
+			onResult(res)
+		}
+	}
+	return report
+}
@@ -0,0 +1,95 @@
+package delold
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// RateLimiter is a token bucket throttling Apply to a fixed number of
+// files or bytes per second, so deleting from slow or network storage
+// doesn't saturate it.
+type RateLimiter struct {
+	mu      sync.Mutex
+	byBytes bool
+	rate    float64 // tokens per second
+	burst   float64
+	tokens  float64
+	last    time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing ratePerSecond tokens per
+// second, with a burst equal to one second's worth of tokens. When
+// byBytes is true, Wait is expected to be called with each entry's size
+// as the token cost; otherwise each call costs one token.
+func NewRateLimiter(ratePerSecond float64, byBytes bool) *RateLimiter {
+	return &RateLimiter{
+		byBytes: byBytes,
+		rate:    ratePerSecond,
+		burst:   ratePerSecond,
+		tokens:  ratePerSecond,
+		last:    time.Now(),
+	}
+}
+
+// Wait blocks until enough tokens are available to account for e, then
+// spends them. Cost is e.Info.Size() in byte mode, or 1 file otherwise.
+func (r *RateLimiter) Wait(e Entry) {
+	cost := 1.0
+	if r.byBytes {
+		cost = float64(e.Info.Size())
+		if cost <= 0 {
+			return
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+
+	if r.tokens < cost {
+		wait := time.Duration((cost - r.tokens) / r.rate * float64(time.Second))
+		time.Sleep(wait)
+		r.tokens = 0
+		r.last = time.Now()
+		return
+	}
+	r.tokens -= cost
+}
+
+// ParseRateLimit parses a --rate-limit value: a bare number followed by
+// "/s" for files per second (e.g. "20/s"), or a byte size followed by
+// "/s" for bytes per second (e.g. "5MiB/s"), using the same IEC/SI units
+// as --min-size/--max-size.
+func ParseRateLimit(s string) (ratePerSecond float64, byBytes bool, err error) {
+	if !strings.HasSuffix(s, "/s") {
+		return 0, false, fmt.Errorf("invalid rate limit %q, expected a value like 20/s or 5MiB/s", s)
+	}
+	numPart := strings.TrimSuffix(s, "/s")
+
+	if n, err := strconv.ParseFloat(numPart, 64); err == nil {
+		if n <= 0 {
+			return 0, false, fmt.Errorf("invalid rate limit %q: rate must be greater than 0", s)
+		}
+		return n, false, nil
+	}
+
+	n, err := humanize.ParseBytes(numPart)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid rate limit %q: %w", s, err)
+	}
+	if n == 0 {
+		return 0, false, fmt.Errorf("invalid rate limit %q: rate must be greater than 0", s)
+	}
+	return float64(n), true, nil
+}
@@ -0,0 +1,155 @@
+package delold
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ParseDuration parses a duration using the s/m/h suffixes understood by
+// time.ParseDuration, plus the d (day) and w (week) suffixes used by
+// --older-than/--newer-than. A d or w value is a single number and unit,
+// e.g. "7d" or "1.5w"; combined forms such as "1d12h" are rejected, while
+// s/m/h-only forms such as "1h30m" are accepted as time.ParseDuration does.
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	switch unit := s[len(s)-1]; unit {
+	case 'd', 'w':
+		n, err := strconv.ParseFloat(s[:len(s)-1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		day := float64(24 * time.Hour)
+		if unit == 'w' {
+			day *= 7
+		}
+		return time.Duration(n * day), nil
+	default:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		return d, nil
+	}
+}
+
+// AgePredicate builds a filter matching entries whose ModTime is older than
+// d when newer is false, or newer than d when newer is true.
+func AgePredicate(d time.Duration, newer bool) func(Entry) bool {
+	cutoff := time.Now().Add(-d)
+	if newer {
+		return func(e Entry) bool { return e.Info.ModTime().After(cutoff) }
+	}
+	return func(e Entry) bool { return e.Info.ModTime().Before(cutoff) }
+}
+
+// RetentionPolicy describes a rotation policy applied to a set of already
+// matched entries: partition them into groups, then within each group keep
+// the entries selected by KeepLast/KeepDaily/KeepWeekly/KeepMonthly and
+// report the rest as deletion candidates.
+type RetentionPolicy struct {
+	GroupBy     *regexp.Regexp
+	KeepLast    int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+}
+
+// Active reports whether any retention rule is configured. When it isn't,
+// the caller should fall back to plain count-based selection instead.
+func (p RetentionPolicy) Active() bool {
+	return p.GroupBy != nil || p.KeepLast > 0 || p.KeepDaily > 0 || p.KeepWeekly > 0 || p.KeepMonthly > 0
+}
+
+// ApplyRetention partitions entries into groups and returns the entries
+// that are not kept by the policy in any group, i.e. the ones to delete.
+func ApplyRetention(entries []Entry, policy RetentionPolicy) []Entry {
+	groups := groupEntries(entries, policy.GroupBy)
+
+	groupKeys := make([]string, 0, len(groups))
+	for k := range groups {
+		groupKeys = append(groupKeys, k)
+	}
+	sort.Strings(groupKeys)
+
+	toDelete := make([]Entry, 0, len(entries))
+	for _, k := range groupKeys {
+		toDelete = append(toDelete, selectForDeletion(groups[k], policy)...)
+	}
+	return toDelete
+}
+
+// groupEntries partitions entries by the first capture group of groupBy.
+// Entries whose path does not match groupBy are left out of every group,
+// since there is no bucket they could safely be rotated against.
+func groupEntries(entries []Entry, groupBy *regexp.Regexp) map[string][]Entry {
+	groups := make(map[string][]Entry)
+	for _, e := range entries {
+		key := ""
+		if groupBy != nil {
+			m := groupBy.FindStringSubmatch(e.Path)
+			if len(m) < 2 {
+				continue
+			}
+			key = m[1]
+		}
+		groups[key] = append(groups[key], e)
+	}
+	return groups
+}
+
+// selectForDeletion sorts a group newest-first, marks the entries kept by
+// the policy, and returns everything else.
+func selectForDeletion(group []Entry, policy RetentionPolicy) []Entry {
+	group = append([]Entry(nil), group...)
+	sort.Sort(sort.Reverse(sortByModtime(group)))
+
+	keep := make([]bool, len(group))
+	for i := 0; i < policy.KeepLast && i < len(group); i++ {
+		keep[i] = true
+	}
+	keepByBucket(group, keep, policy.KeepDaily, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+	keepByBucket(group, keep, policy.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	})
+	keepByBucket(group, keep, policy.KeepMonthly, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+
+	toDelete := make([]Entry, 0, len(group))
+	for i, e := range group {
+		if !keep[i] {
+			toDelete = append(toDelete, e)
+		}
+	}
+	return toDelete
+}
+
+// keepByBucket walks group newest-first and marks up to n entries as kept,
+// one per distinct bucket as identified by bucketOf, e.g. one per calendar
+// day for KeepDaily.
+func keepByBucket(group []Entry, keep []bool, n int, bucketOf func(time.Time) string) {
+	if n <= 0 {
+		return
+	}
+	seen := make(map[string]bool, n)
+	for i, e := range group {
+		if len(seen) >= n {
+			break
+		}
+		b := bucketOf(e.Info.ModTime())
+		if seen[b] {
+			continue
+		}
+		seen[b] = true
+		keep[i] = true
+	}
+}
@@ -0,0 +1,138 @@
+package delold
+
+import (
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// fakeInfo is a minimal os.FileInfo for tests that only care about Name,
+// Size and ModTime.
+type fakeInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (f fakeInfo) Name() string       { return f.name }
+func (f fakeInfo) Size() int64        { return f.size }
+func (f fakeInfo) Mode() os.FileMode  { return 0o644 }
+func (f fakeInfo) ModTime() time.Time { return f.modTime }
+func (f fakeInfo) IsDir() bool        { return false }
+func (f fakeInfo) Sys() any           { return nil }
+
+func entryAt(path string, t time.Time) Entry {
+	return Entry{Path: path, Info: fakeInfo{name: path, modTime: t}}
+}
+
+func TestApplyRetention_Inactive(t *testing.T) {
+	var p RetentionPolicy
+	if p.Active() {
+		t.Fatal("zero-value RetentionPolicy should not be active")
+	}
+}
+
+func TestApplyRetention_EmptyInput(t *testing.T) {
+	p := RetentionPolicy{KeepLast: 2}
+	if got := ApplyRetention(nil, p); len(got) != 0 {
+		t.Fatalf("ApplyRetention(nil) = %v, want empty", got)
+	}
+}
+
+func TestApplyRetention_KeepLast(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		entryAt("a", base),
+		entryAt("b", base.Add(time.Hour)),
+		entryAt("c", base.Add(2*time.Hour)),
+	}
+
+	toDelete := ApplyRetention(entries, RetentionPolicy{KeepLast: 2})
+	if len(toDelete) != 1 || toDelete[0].Path != "a" {
+		t.Fatalf("ApplyRetention(KeepLast:2) = %v, want [a]", toDelete)
+	}
+}
+
+func TestApplyRetention_KeepLastTie(t *testing.T) {
+	// Two entries with the same ModTime: sort.Sort is not required to be
+	// stable, but selectForDeletion must still end up keeping exactly
+	// KeepLast entries out of the group regardless of order.
+	same := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{entryAt("a", same), entryAt("b", same)}
+
+	toDelete := ApplyRetention(entries, RetentionPolicy{KeepLast: 1})
+	if len(toDelete) != 1 {
+		t.Fatalf("ApplyRetention(KeepLast:1) on a tie = %v, want exactly 1 entry", toDelete)
+	}
+}
+
+func TestApplyRetention_GroupByExcludesNonMatching(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		entryAt("db-1.bak", base),
+		entryAt("db-2.bak", base.Add(time.Hour)),
+		entryAt("no-group-here", base.Add(2*time.Hour)),
+	}
+
+	policy := RetentionPolicy{
+		GroupBy:  regexp.MustCompile(`^(db)-\d+\.bak$`),
+		KeepLast: 1,
+	}
+	toDelete := ApplyRetention(entries, policy)
+
+	// "no-group-here" never matches GroupBy, so it falls into no bucket and
+	// is neither kept nor reported for deletion.
+	if len(toDelete) != 1 || toDelete[0].Path != "db-1.bak" {
+		t.Fatalf("ApplyRetention(GroupBy) = %v, want [db-1.bak]", toDelete)
+	}
+}
+
+func TestApplyRetention_KeepDailyBucketsByCalendarDay(t *testing.T) {
+	d1 := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	d1Later := time.Date(2026, 1, 1, 20, 0, 0, 0, time.UTC)
+	d2 := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		entryAt("d1-morning", d1),
+		entryAt("d1-evening", d1Later),
+		entryAt("d2", d2),
+	}
+
+	// KeepDaily counts distinct days to keep, not entries per day, so with
+	// KeepDaily:2 the newest entry in each of the two days is kept: d2, and
+	// whichever of the two Jan-1 entries sorts first newest-first.
+	toDelete := ApplyRetention(entries, RetentionPolicy{KeepDaily: 2})
+	if len(toDelete) != 1 || toDelete[0].Path != "d1-morning" {
+		t.Fatalf("ApplyRetention(KeepDaily:2) = %v, want [d1-morning]", toDelete)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "1d", want: 24 * time.Hour},
+		{in: "2w", want: 14 * 24 * time.Hour},
+		{in: "90m", want: 90 * time.Minute},
+		{in: "", wantErr: true},
+		{in: "not-a-duration", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := ParseDuration(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("ParseDuration(%q) = %v, want error", c.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDuration(%q) returned error: %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("ParseDuration(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package delold
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// ScanOptions controls how Scan traverses a directory.
+type ScanOptions struct {
+	Dir            string
+	Recursive      bool
+	MaxDepth       int // negative means unlimited; ignored unless Recursive is set
+	FollowSymlinks bool
+	Include        []*regexp.Regexp
+	Exclude        []*regexp.Regexp
+}
+
+// CompilePatterns compiles a set of regular expressions, as used for the
+// Include/Exclude fields of ScanOptions.
+func CompilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// sameAsAny reports whether fi refers to the same file as any of others, as
+// determined by os.SameFile (device+inode on Unix).
+func sameAsAny(fi os.FileInfo, others []os.FileInfo) bool {
+	for _, o := range others {
+		if os.SameFile(fi, o) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// candidate is a file found while walking the directory tree, named but
+// not yet stat'ed.
+type candidate struct {
+	absPath string
+	relPath string
+}
+
+// Scan lists the files under opt.Dir, sorted oldest-modified first. The
+// directory tree itself is always walked sequentially (each directory's
+// listing depends on its parent having been read first), but the stat call
+// needed to read each candidate's size and mtime is the expensive part on
+// a large recursive tree, and is run through a bounded worker pool when
+// opt.Recursive is set.
+func Scan(opt ScanOptions) ([]Entry, error) {
+	rootInfo, err := os.Stat(opt.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat root directory: %w", err)
+	}
+
+	var candidates []candidate
+	if err := walkDir(opt.Dir, "", 0, opt, &candidates, []os.FileInfo{rootInfo}); err != nil {
+		return nil, err
+	}
+
+	var arrEntry []Entry
+	if opt.Recursive {
+		arrEntry, err = statParallel(candidates)
+	} else {
+		arrEntry, err = statSequential(candidates)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(sortByModtime(arrEntry))
+	return arrEntry, nil
+}
+
+// walkDir reads absDir, whose path relative to the directory being scanned
+// is relDir, and appends matching files to result. Directories matching
+// Exclude are pruned before their contents are ever read, and files are
+// tested against Include/Exclude before being stat'ed, so a huge subtree
+// can be skipped without the cost of walking it.
+//
+// ancestors holds the FileInfo of absDir itself and every directory above it
+// back to the scan root, so that a followed symlink pointing back at one of
+// them can be detected and skipped instead of recursing forever, mirroring
+// the loop guard in restic's archiver.
+func walkDir(absDir, relDir string, depth int, opt ScanOptions, result *[]candidate, ancestors []os.FileInfo) error {
+	fdDir, err := os.Open(absDir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory: %w", err)
+	}
+	defer fdDir.Close()
+	dirInfo, err := fdDir.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat directory: %w", err)
+	}
+	if !dirInfo.IsDir() {
+		return fmt.Errorf("given path is not a directory")
+	}
+
+	arrDirEntry, err := fdDir.ReadDir(-1)
+	if err != nil {
+		return fmt.Errorf("failed to read entries in directory: %w", err)
+	}
+
+	for _, de := range arrDirEntry {
+		relPath := de.Name()
+		if relDir != "" {
+			relPath = path.Join(relDir, de.Name())
+		}
+		absPath := path.Join(absDir, de.Name())
+
+		isDir := de.IsDir()
+		isSymlink := de.Type()&fs.ModeSymlink != 0
+		var childInfo os.FileInfo
+		if isSymlink {
+			if !opt.FollowSymlinks {
+				continue
+			}
+			fi, err := os.Stat(absPath)
+			if err != nil {
+				continue
+			}
+			isDir = fi.IsDir()
+			childInfo = fi
+		}
+
+		if matchAny(opt.Exclude, relPath) {
+			continue
+		}
+
+		if isDir {
+			if !opt.Recursive {
+				continue
+			}
+			if opt.MaxDepth >= 0 && depth >= opt.MaxDepth {
+				continue
+			}
+			if isSymlink && sameAsAny(childInfo, ancestors) {
+				// Following this symlink would revisit a directory already
+				// open higher up the current path, e.g. a symlink pointing
+				// at an ancestor: skip it instead of recursing forever.
+				continue
+			}
+			if childInfo == nil {
+				if childInfo, err = os.Lstat(absPath); err != nil {
+					continue
+				}
+			}
+			if err := walkDir(absPath, relPath, depth+1, opt, result, append(ancestors, childInfo)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(opt.Include) > 0 && !matchAny(opt.Include, relPath) {
+			continue
+		}
+
+		*result = append(*result, candidate{absPath: absPath, relPath: relPath})
+	}
+	return nil
+}
+
+func statSequential(candidates []candidate) ([]Entry, error) {
+	arrEntry := make([]Entry, 0, len(candidates))
+	for _, c := range candidates {
+		fi, err := os.Lstat(c.absPath)
+		if err != nil {
+			continue
+		}
+		arrEntry = append(arrEntry, Entry{Path: c.relPath, Info: fi})
+	}
+	return arrEntry, nil
+}
+
+// statParallel stats candidates through a bounded worker pool, mirroring
+// the hashAll pipeline used by --dedup.
+func statParallel(candidates []candidate) ([]Entry, error) {
+	workers := runtime.NumCPU()
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(candidates) {
+		workers = len(candidates)
+	}
+	if workers == 0 {
+		return nil, nil
+	}
+
+	jobs := make(chan candidate)
+	results := make(chan Entry)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				fi, err := os.Lstat(c.absPath)
+				if err != nil {
+					continue
+				}
+				results <- Entry{Path: c.relPath, Info: fi}
+			}
+		}()
+	}
+
+	go func() {
+		for _, c := range candidates {
+			jobs <- c
+		}
+		close(jobs)
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	arrEntry := make([]Entry, 0, len(candidates))
+	for e := range results {
+		arrEntry = append(arrEntry, e)
+	}
+	return arrEntry, nil
+}
+
+type sortByModtime []Entry
+
+func (s sortByModtime) Len() int      { return len(s) }
+func (s sortByModtime) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s sortByModtime) Less(i, j int) bool {
+	return s[i].Info.ModTime().Before(s[j].Info.ModTime())
+}
@@ -0,0 +1,267 @@
+package delold
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const trashInfoSuffix = ".trashinfo"
+
+// Deleter is how an Entry is actually removed from disk. RemoveDeleter
+// unlinks it; BackupDeleter and TrashDeleter move it somewhere recoverable
+// instead.
+type Deleter interface {
+	Delete(prefix string, e Entry) error
+}
+
+// RemoveDeleter is the original behavior: unlink the file. With Secure set
+// it first overwrites the file's contents with zeros.
+type RemoveDeleter struct {
+	Secure bool
+}
+
+func (r RemoveDeleter) Delete(prefix string, e Entry) error {
+	absPath := path.Join(prefix, e.Path)
+	if r.Secure {
+		if err := overwriteWithZeros(absPath, e.Info.Size()); err != nil {
+			return fmt.Errorf("failed to overwrite file contents: %w", err)
+		}
+	}
+	return os.Remove(absPath)
+}
+
+func overwriteWithZeros(name string, size int64) error {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zero := make([]byte, 32*1024)
+	for written := int64(0); written < size; {
+		n := int64(len(zero))
+		if remaining := size - written; remaining < n {
+			n = remaining
+		}
+		if _, err := f.Write(zero[:n]); err != nil {
+			return err
+		}
+		written += n
+	}
+	return f.Sync()
+}
+
+// BackupDeleter moves matched files under Dir instead of deleting them,
+// preserving the path the entry was matched at.
+type BackupDeleter struct {
+	Dir string
+}
+
+func (b BackupDeleter) Delete(prefix string, e Entry) error {
+	absPath := path.Join(prefix, e.Path)
+	dst := path.Join(b.Dir, e.Path)
+	if err := MoveFile(absPath, dst); err != nil {
+		return fmt.Errorf("failed to move file to backup directory: %w", err)
+	}
+	return nil
+}
+
+// TrashDeleter implements the freedesktop.org trash specification: files
+// move to $XDG_DATA_HOME/Trash/files with a sibling .trashinfo file in
+// Trash/info recording where they came from and when they were trashed, so
+// ListTrash and a restore command can put them back.
+type TrashDeleter struct {
+	Dir string
+}
+
+// XDGTrashDir returns the trash directory for the current user, without
+// creating it.
+func XDGTrashDir() (string, error) {
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return path.Join(dataHome, "Trash"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+	return path.Join(home, ".local", "share", "Trash"), nil
+}
+
+// NewTrashDeleter returns a TrashDeleter backed by the user's XDG trash
+// directory, creating it if necessary.
+func NewTrashDeleter() (*TrashDeleter, error) {
+	dir, err := XDGTrashDir()
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(path.Join(dir, sub), 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create trash directory: %w", err)
+		}
+	}
+	return &TrashDeleter{Dir: dir}, nil
+}
+
+func (t *TrashDeleter) Delete(prefix string, e Entry) error {
+	absPath, err := filepath.Abs(path.Join(prefix, e.Path))
+	if err != nil {
+		return fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+
+	name, infoFile, err := claimTrashName(t.Dir, path.Base(e.Path))
+	if err != nil {
+		return fmt.Errorf("failed to claim trash name: %w", err)
+	}
+	infoPath := path.Join(t.Dir, "info", name+trashInfoSuffix)
+	body := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: absPath}).EscapedPath(),
+		time.Now().Format("2006-01-02T15:04:05"))
+	_, writeErr := infoFile.WriteString(body)
+	closeErr := infoFile.Close()
+	if writeErr != nil {
+		os.Remove(infoPath)
+		return fmt.Errorf("failed to write trashinfo file: %w", writeErr)
+	}
+	if closeErr != nil {
+		os.Remove(infoPath)
+		return fmt.Errorf("failed to write trashinfo file: %w", closeErr)
+	}
+
+	if err := MoveFile(absPath, path.Join(t.Dir, "files", name)); err != nil {
+		os.Remove(infoPath)
+		return fmt.Errorf("failed to move file to trash: %w", err)
+	}
+	return nil
+}
+
+// claimTrashName finds a name for base that does not already exist in the
+// trash and atomically claims it by creating its .trashinfo file with
+// O_EXCL, returning the open file for the caller to write into. This closes
+// the check-then-act race that a bare os.Stat loop would have under the
+// concurrent workers Apply runs Delete from: two goroutines claiming the
+// same base name can't both win the O_EXCL create.
+func claimTrashName(trashDir, base string) (name string, infoFile *os.File, err error) {
+	name = base
+	for i := 1; ; i++ {
+		infoPath := path.Join(trashDir, "info", name+trashInfoSuffix)
+		f, err := os.OpenFile(infoPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			return name, f, nil
+		}
+		if !os.IsExist(err) {
+			return "", nil, err
+		}
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+}
+
+// MoveFile renames src to dst, creating dst's parent directory if needed
+// and falling back to a copy+fsync+rename+unlink when src and dst are on
+// different filesystems.
+func MoveFile(src, dst string) error {
+	if err := os.MkdirAll(path.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || !errors.Is(linkErr.Err, syscall.EXDEV) {
+		return err
+	}
+	return copyThenRemove(src, dst)
+}
+
+func copyThenRemove(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to sync copied file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to close copied file: %w", err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to rename temporary file into place: %w", err)
+	}
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("failed to remove source file after copy: %w", err)
+	}
+	return nil
+}
+
+// TrashedItem is one file currently sitting in the trash, parsed from its
+// .trashinfo sidecar.
+type TrashedItem struct {
+	Name         string // name under Trash/files and Trash/info
+	OriginalPath string
+	DeletionDate string
+}
+
+// ListTrash reads the .trashinfo sidecars under dir/info, oldest first.
+func ListTrash(dir string) ([]TrashedItem, error) {
+	infoDir := path.Join(dir, "info")
+	des, err := os.ReadDir(infoDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read trash info directory: %w", err)
+	}
+
+	items := make([]TrashedItem, 0, len(des))
+	for _, de := range des {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), trashInfoSuffix) {
+			continue
+		}
+		raw, err := os.ReadFile(path.Join(infoDir, de.Name()))
+		if err != nil {
+			continue
+		}
+
+		item := TrashedItem{Name: strings.TrimSuffix(de.Name(), trashInfoSuffix)}
+		for _, line := range strings.Split(string(raw), "\n") {
+			switch {
+			case strings.HasPrefix(line, "Path="):
+				if u, err := url.Parse(strings.TrimPrefix(line, "Path=")); err == nil {
+					item.OriginalPath = u.Path
+				}
+			case strings.HasPrefix(line, "DeletionDate="):
+				item.DeletionDate = strings.TrimPrefix(line, "DeletionDate=")
+			}
+		}
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletionDate < items[j].DeletionDate })
+	return items, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/Xiangze-Li/delete-old-files/pkg/delold"
+)
+
+// progressReporter renders a live "files/sec, bytes freed, ETA" line to
+// stderr as deletions complete. It is safe to call record from multiple
+// goroutines.
+type progressReporter struct {
+	mu         sync.Mutex
+	total      int
+	done       int
+	bytesFreed uint64
+	start      time.Time
+	lastRender time.Time
+}
+
+func newProgressReporter(total int) *progressReporter {
+	return &progressReporter{total: total, start: time.Now()}
+}
+
+const progressRenderInterval = 100 * time.Millisecond
+
+func (p *progressReporter) record(res delold.Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done++
+	if res.Error == "" {
+		p.bytesFreed += uint64(res.Entry.Info.Size())
+	}
+
+	now := time.Now()
+	if now.Sub(p.lastRender) < progressRenderInterval && p.done < p.total {
+		return
+	}
+	p.lastRender = now
+	p.render()
+}
+
+func (p *progressReporter) render() {
+	elapsed := time.Since(p.start).Seconds()
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(p.done) / elapsed
+	}
+
+	eta := "?"
+	if rate > 0 {
+		remaining := p.total - p.done
+		eta = time.Duration(float64(remaining) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+
+	fmt.Fprintf(os.Stderr, "\r%d/%d files, %.1f files/s, %s freed, ETA %s    ",
+		p.done, p.total, rate, humanize.IBytes(p.bytesFreed), eta)
+	if p.done >= p.total {
+		fmt.Fprintln(os.Stderr)
+	}
+}